@@ -1,16 +1,25 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"log"
 	"math"
 	"math/rand"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -119,7 +128,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	log.Printf("[REQUEST] %s %s", req.Method, req.URL)
 
 	switch req.Method {
-	case http.MethodGet:
+	case http.MethodGet, http.MethodHead:
 		h.ServeDownload(w, req)
 	case http.MethodPut:
 		h.ServeUpload(w, req)
@@ -129,7 +138,80 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-// ServeDownload responds with a random binary file of the requested size.
+// errMultipleRanges is returned by parseRange when a Range header specifies
+// more than one range. srcsnk does not support multipart/byteranges
+// responses, so callers should treat this as 416 Range Not Satisfiable.
+var errMultipleRanges = errors.New("multiple ranges are not supported")
+
+// byteRange is an inclusive range of byte offsets into a resource of a given
+// size, as specified by RFC 7233.
+type byteRange struct {
+	Start int64
+	End   int64
+}
+
+// parseRange parses the value of a Range header for a resource of the given
+// size. It only supports a single range; if header specifies more than one
+// range, it returns errMultipleRanges.
+func parseRange(header string, size int64) (byteRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return byteRange{}, fmt.Errorf("unsupported range unit")
+	}
+	spec := strings.TrimPrefix(header, prefix)
+
+	if strings.Contains(spec, ",") {
+		return byteRange{}, errMultipleRanges
+	}
+
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return byteRange{}, fmt.Errorf("malformed range")
+	}
+
+	if parts[0] == "" {
+		// A suffix range requests the last N bytes of the resource.
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n <= 0 {
+			return byteRange{}, fmt.Errorf("malformed range")
+		}
+		if n > size {
+			n = size
+		}
+		return byteRange{Start: size - n, End: size - 1}, nil
+	}
+
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return byteRange{}, fmt.Errorf("range start out of bounds")
+	}
+
+	end := size - 1
+	if parts[1] != "" {
+		end, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || end < start {
+			return byteRange{}, fmt.Errorf("malformed range")
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	return byteRange{Start: start, End: end}, nil
+}
+
+// ServeDownload responds with a binary file of the requested size. It
+// supports HEAD requests, which return the same headers as GET without a
+// body, and single-range Range requests, which return 206 Partial Content;
+// multi-range requests are rejected with 416 Range Not Satisfiable. The
+// payload defaults to a time-seeded random stream, but the seed and pattern
+// query parameters select a reproducible or fixed-pattern stream instead,
+// and the payload query parameter adds a checksum of the response body as an
+// HTTP trailer. The chunked query parameter switches to a chunked-transfer
+// streaming mode, served by serveChunkedDownload; the payload parameter is not
+// applied in that mode, where only trailer=sha256 adds a checksum. Finally, the failAt,
+// stallAt, slowHeaders, and status query parameters deterministically
+// inject connection and response faults for client resilience testing.
 func (h *Handler) ServeDownload(w http.ResponseWriter, req *http.Request) {
 	size, err := getSize(req)
 	if err != nil {
@@ -149,21 +231,387 @@ func (h *Handler) ServeDownload(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	src := rand.NewSource(time.Now().Unix())
-	r := NewReader(rand.New(src), limit)
+	chunk, err := getChunkParams(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	source, err := getPayloadSource(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	checksum, err := getChecksumKind(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	faults, err := getFaultParams(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if chunk.Enabled {
+		if faults.SlowHeaders > 0 {
+			http.Error(w, "slowHeaders is not supported together with chunked", http.StatusBadRequest)
+			return
+		}
+		if req.Header.Get("Range") != "" {
+			// Chunked responses don't advertise Accept-Ranges and don't
+			// support Range requests, so reject explicitly rather than
+			// silently ignoring the header and returning a full 200 body.
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			code := http.StatusRequestedRangeNotSatisfiable
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		h.serveChunkedDownload(w, req, source, size, limit, preDelay, resDelay, chunk, faults)
+		return
+	}
+
+	var rng byteRange
+	hasRange := false
+	if header := req.Header.Get("Range"); header != "" {
+		rng, err = parseRange(header, size)
+		if err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			code := http.StatusRequestedRangeNotSatisfiable
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		hasRange = true
+	}
+
+	r := NewReader(source, limit)
 
 	w.Header().Add("Content-Type", "application/octet-stream")
-	w.Header().Add("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Add("Accept-Ranges", "bytes")
 
 	time.Sleep(preDelay + resDelay)
 
-	w.WriteHeader(http.StatusOK)
-	if n, err := io.CopyN(w, r, size); err != nil {
-		log.Printf("[ERROR] incomplete write: wanted = %d, wrote = %d: %v\n", size, n, err)
+	length := size
+	status := http.StatusOK
+	if hasRange {
+		length = rng.End - rng.Start + 1
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rng.Start, rng.End, size))
+		status = http.StatusPartialContent
+	}
+	if faults.Status != 0 {
+		status = faults.Status
+	}
+
+	if hasRange && rng.Start > 0 {
+		if _, err := io.CopyN(ioutil.Discard, r, rng.Start); err != nil {
+			log.Printf("[ERROR] failed to skip to range start: %v\n", err)
+			return
+		}
+	}
+
+	// A checksum can only be known once the whole body has been produced, so
+	// it is sent as an HTTP trailer instead of a regular header, the same
+	// way serveChunkedDownload sends one: the body is streamed straight to w
+	// while being hashed, with no buffering and no cap on size. Trailers
+	// require chunked transfer-encoding, so Content-Length is intentionally
+	// left unset on this path. The failAt, stallAt, and slowHeaders faults are
+	// rejected outright here (a forced status is still honored),
+	// consistent with the chunked+slowHeaders rejection above: silently
+	// serving a normal response when the client asked for a faulty one
+	// would be a correctness trap for a tool whose purpose is deterministic
+	// fault injection.
+	if checksum != "" {
+		if faults.FailAt >= 0 || faults.StallAt >= 0 || faults.SlowHeaders > 0 {
+			msg := "fault injection is not supported together with payload checksums"
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		sum := newChecksumHash(checksum)
+		body := io.TeeReader(r, sum)
+
+		w.Header().Set("Trailer", checksumHeader(checksum))
+		w.WriteHeader(status)
+		if req.Method == http.MethodHead {
+			return
+		}
+		if n, err := io.CopyN(w, body, length); err != nil {
+			log.Printf("[ERROR] incomplete write: wanted = %d, wrote = %d: %v\n", length, n, err)
+			return
+		}
+		w.Header().Set(checksumHeader(checksum), hex.EncodeToString(sum.Sum(nil)))
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+
+	if faults.SlowHeaders > 0 {
+		conn, err := writeSlowHeaders(w, status, faults.SlowHeaders)
+		if err != nil {
+			log.Printf("[ERROR] slowHeaders: %v\n", err)
+			return
+		}
+		defer conn.Close()
+		if req.Method == http.MethodHead {
+			return
+		}
+
+		if halted, _, err := faultyCopy(conn, r, length, faults, func() { resetAndClose(conn) }); err != nil {
+			log.Printf("[ERROR] incomplete write: wanted = %d: %v\n", length, err)
+		} else if halted {
+			log.Printf("[FAULT] connection reset after %d bytes\n", faults.FailAt)
+		}
+		return
+	}
+
+	w.WriteHeader(status)
+	if req.Method == http.MethodHead {
+		return
+	}
+
+	if halted, _, err := faultyCopy(w, r, length, faults, func() { resetConnection(w) }); err != nil {
+		log.Printf("[ERROR] incomplete write: wanted = %d: %v\n", length, err)
+	} else if halted {
+		log.Printf("[FAULT] connection reset after %d bytes\n", faults.FailAt)
+	}
+}
+
+// getPayloadSource returns the reader that produces download payload bytes,
+// selected by the pattern and seed query parameters. pattern takes priority
+// over seed; with neither set, a fresh time-seeded pseudo-random stream is
+// used, matching the original, non-reproducible behavior.
+func getPayloadSource(req *http.Request) (io.Reader, error) {
+	q := req.URL.Query()
+
+	if pattern := q.Get("pattern"); pattern != "" {
+		r, err := newPatternReader(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern: %v", err)
+		}
+		return r, nil
+	}
+
+	seed := time.Now().Unix()
+	if s := q.Get("seed"); s != "" {
+		parsed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("seed: %v", err)
+		}
+		seed = parsed
+	}
+	return rand.New(rand.NewSource(seed)), nil
+}
+
+// patternReader is an io.Reader that repeats a fixed byte sequence
+// indefinitely.
+type patternReader struct {
+	pattern []byte
+	pos     int
+}
+
+// newPatternReader creates a patternReader for the named pattern: "zero" for
+// all-zero bytes, "ones" for all-0xFF bytes, "counter" for a repeating
+// 0x00-0xFF sequence, or a hex string giving an arbitrary repeating pattern.
+func newPatternReader(name string) (*patternReader, error) {
+	switch name {
+	case "zero":
+		return &patternReader{pattern: []byte{0x00}}, nil
+	case "ones":
+		return &patternReader{pattern: []byte{0xFF}}, nil
+	case "counter":
+		pattern := make([]byte, 256)
+		for i := range pattern {
+			pattern[i] = byte(i)
+		}
+		return &patternReader{pattern: pattern}, nil
+	default:
+		b, err := hex.DecodeString(name)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("unknown pattern %q", name)
+		}
+		return &patternReader{pattern: b}, nil
+	}
+}
+
+func (p *patternReader) Read(buf []byte) (int, error) {
+	for i := range buf {
+		buf[i] = p.pattern[p.pos]
+		p.pos = (p.pos + 1) % len(p.pattern)
+	}
+	return len(buf), nil
+}
+
+// getChecksumKind parses the payload query parameter, which selects a
+// checksum algorithm to compute over the response body and return in a
+// response trailer. An empty result means no checksum was requested.
+func getChecksumKind(req *http.Request) (string, error) {
+	switch kind := req.URL.Query().Get("payload"); kind {
+	case "", "sha256", "crc32":
+		return kind, nil
+	default:
+		return "", fmt.Errorf("payload: unknown checksum: %s", kind)
+	}
+}
+
+// checksumHeader returns the response header name used to report a checksum
+// of the given kind.
+func checksumHeader(kind string) string {
+	if kind == "crc32" {
+		return "X-Content-CRC32"
+	}
+	return "X-Content-SHA256"
+}
+
+// newChecksumHash returns a hash.Hash implementing the checksum algorithm of
+// the given kind, for incrementally hashing a streamed response body.
+func newChecksumHash(kind string) hash.Hash {
+	if kind == "crc32" {
+		return crc32.NewIEEE()
+	}
+	return sha256.New()
+}
+
+// DefaultChunkSize is the chunk size used for chunked downloads when the
+// chunkSize query parameter is not given.
+const DefaultChunkSize int64 = 32 * 1024
+
+// chunkParams holds the parsed chunked-transfer query parameters for
+// ServeDownload.
+type chunkParams struct {
+	Enabled bool
+	Size    int64
+	Delay   time.Duration
+	Trailer bool
+}
+
+// getChunkParams parses the chunked, chunkSize, chunkDelay, and trailer query
+// parameters controlling chunked-transfer downloads.
+func getChunkParams(req *http.Request) (chunkParams, error) {
+	q := req.URL.Query()
+
+	var p chunkParams
+	if q.Get("chunked") != "true" {
+		return p, nil
+	}
+	p.Enabled = true
+
+	p.Size = DefaultChunkSize
+	if s := q.Get("chunkSize"); s != "" {
+		size, err := ParseSize(s)
+		if err != nil {
+			return chunkParams{}, fmt.Errorf("chunkSize: %v", err)
+		}
+		if size <= 0 {
+			return chunkParams{}, fmt.Errorf("chunkSize: must be positive")
+		}
+		p.Size = size
 	}
+
+	if d := q.Get("chunkDelay"); d != "" {
+		delay, err := time.ParseDuration(d)
+		if err != nil {
+			return chunkParams{}, fmt.Errorf("chunkDelay: %v", err)
+		}
+		p.Delay = delay
+	}
+
+	p.Trailer = q.Get("trailer") == "sha256"
+
+	return p, nil
 }
 
-// ServeUpload reads and discards all data in the request body.
+// serveChunkedDownload streams size bytes read from source in fixed-size
+// chunks separated by chunk.Delay, flushing after each one so the client
+// observes genuine chunked-transfer-encoding framing rather than a single
+// buffered write. If chunk.Trailer is set, it sends a final X-Content-SHA256
+// trailer with the SHA-256 of the streamed bytes. faults.Status overrides the
+// response status, and faults.FailAt/StallAt are honored across the whole
+// stream regardless of chunk boundaries; faults.SlowHeaders is not supported
+// here and must be rejected by the caller. Range requests are not supported
+// either, so unlike ServeDownload's other paths this response does not
+// advertise Accept-Ranges; the caller must reject a Range request up front.
+func (h *Handler) serveChunkedDownload(w http.ResponseWriter, req *http.Request, source io.Reader, size int64, limit rate.Limit, preDelay, resDelay time.Duration, chunk chunkParams, faults faultParams) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		code := http.StatusInternalServerError
+		http.Error(w, "streaming is not supported by the server", code)
+		return
+	}
+
+	var body io.Reader = NewReader(source, limit)
+
+	var sum hash.Hash
+	if chunk.Trailer {
+		sum = sha256.New()
+		body = io.TeeReader(body, sum)
+	}
+
+	w.Header().Add("Content-Type", "application/octet-stream")
+	w.Header().Set("Transfer-Encoding", "chunked")
+	if chunk.Trailer {
+		w.Header().Set("Trailer", "X-Content-SHA256")
+	}
+
+	time.Sleep(preDelay + resDelay)
+
+	status := http.StatusOK
+	if faults.Status != 0 {
+		status = faults.Status
+	}
+	w.WriteHeader(status)
+	if req.Method == http.MethodHead {
+		return
+	}
+
+	var written int64
+	stalled := false
+	for remaining := size; remaining > 0; {
+		n := chunk.Size
+		if n > remaining {
+			n = remaining
+		}
+
+		chunkFaults := faultParams{FailAt: -1, StallAt: -1}
+		if faults.FailAt >= 0 {
+			chunkFaults.FailAt = faults.FailAt - written
+		}
+		if faults.StallAt >= 0 && !stalled {
+			chunkFaults.StallAt = faults.StallAt - written
+			chunkFaults.StallFor = faults.StallFor
+		}
+
+		halted, copied, err := faultyCopy(w, body, n, chunkFaults, func() { resetConnection(w) })
+		written += copied
+		remaining -= copied
+		if copied > 0 {
+			flusher.Flush()
+		}
+		if halted {
+			log.Printf("[FAULT] connection reset after %d bytes\n", written)
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] incomplete chunked write: wanted = %d, remaining = %d: %v\n", size, remaining, err)
+			return
+		}
+		if chunkFaults.StallAt >= 0 && chunkFaults.StallAt < n {
+			stalled = true
+		}
+
+		if remaining > 0 && chunk.Delay > 0 {
+			time.Sleep(chunk.Delay)
+		}
+	}
+
+	if chunk.Trailer {
+		w.Header().Set("X-Content-SHA256", hex.EncodeToString(sum.Sum(nil)))
+	}
+}
+
+// ServeUpload reads and discards all data in the request body, rejecting
+// bodies larger than the configured maximum upload size.
 func (h *Handler) ServeUpload(w http.ResponseWriter, req *http.Request) {
 	limit, err := getLimit(req)
 	if err != nil {
@@ -171,18 +619,55 @@ func (h *Handler) ServeUpload(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	maxSize, err := getMaxUploadSize(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("maxSize: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// If the client already declared a Content-Length over the cap, reject
+	// the upload immediately. Since this happens before req.Body is touched,
+	// net/http sends this response instead of the "100 Continue" interim
+	// response a client may be expecting.
+	if maxSize > 0 && req.ContentLength > maxSize {
+		code := http.StatusRequestEntityTooLarge
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
 	preDelay, resDelay, err := getDelays(req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	r := NewReader(req.Body, limit)
+	faults, err := getFaultParams(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body := req.Body
+	if maxSize > 0 {
+		body = http.MaxBytesReader(w, body, maxSize)
+	}
+	r := NewReader(body, limit)
 
 	time.Sleep(preDelay)
 
-	n, err := io.Copy(ioutil.Discard, r)
+	length := req.ContentLength // -1 if unknown, e.g. a chunked upload
+	halted, n, err := faultyCopy(ioutil.Discard, r, length, faults, func() { resetConnection(w) })
+	if halted {
+		log.Printf("[FAULT] connection reset after reading %d bytes\n", n)
+		return
+	}
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			code := http.StatusRequestEntityTooLarge
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
 		msg := fmt.Sprintf("incomplete read: wanted = %d, wrote = %d: %v\n", req.ContentLength, n, err)
 		http.Error(w, msg, http.StatusInternalServerError)
 		return
@@ -190,7 +675,193 @@ func (h *Handler) ServeUpload(w http.ResponseWriter, req *http.Request) {
 
 	time.Sleep(resDelay)
 
-	w.WriteHeader(http.StatusCreated)
+	status := http.StatusCreated
+	if faults.Status != 0 {
+		status = faults.Status
+	}
+
+	if faults.SlowHeaders > 0 {
+		conn, err := writeSlowHeaders(w, status, faults.SlowHeaders)
+		if err != nil {
+			log.Printf("[ERROR] slowHeaders: %v\n", err)
+			return
+		}
+		conn.Close()
+		return
+	}
+
+	w.WriteHeader(status)
+}
+
+// faultParams holds the parsed fault-injection query parameters shared by
+// ServeDownload and ServeUpload.
+type faultParams struct {
+	FailAt      int64 // reset the connection after this many bytes; <0 disables
+	StallAt     int64 // pause for StallFor after this many bytes; <0 disables
+	StallFor    time.Duration
+	SlowHeaders time.Duration // write the status line/headers one byte at a time over this duration; 0 disables
+	Status      int           // force this response status instead of the usual one; 0 disables
+}
+
+// getFaultParams parses the failAt, stallAt, stallFor, slowHeaders, and
+// status query parameters used to deterministically inject faults into
+// downloads and uploads for client resilience testing.
+func getFaultParams(req *http.Request) (faultParams, error) {
+	p := faultParams{FailAt: -1, StallAt: -1}
+	q := req.URL.Query()
+
+	if s := q.Get("failAt"); s != "" {
+		n, err := ParseSize(s)
+		if err != nil {
+			return faultParams{}, fmt.Errorf("failAt: %v", err)
+		}
+		p.FailAt = n
+	}
+
+	if s := q.Get("stallAt"); s != "" {
+		n, err := ParseSize(s)
+		if err != nil {
+			return faultParams{}, fmt.Errorf("stallAt: %v", err)
+		}
+		d, err := time.ParseDuration(q.Get("stallFor"))
+		if err != nil {
+			return faultParams{}, fmt.Errorf("stallFor: %v", err)
+		}
+		p.StallAt = n
+		p.StallFor = d
+	}
+
+	if s := q.Get("slowHeaders"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return faultParams{}, fmt.Errorf("slowHeaders: %v", err)
+		}
+		p.SlowHeaders = d
+	}
+
+	if s := q.Get("status"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 100 || n > 599 {
+			return faultParams{}, fmt.Errorf("status: invalid status code: %s", s)
+		}
+		p.Status = n
+	}
+
+	return p, nil
+}
+
+// faultyCopy copies from src to dst, stopping after length bytes, or
+// indefinitely until src is exhausted if length is negative. It honors
+// faults.StallAt/StallFor, sleeping once after that many bytes have been
+// copied, and faults.FailAt, calling reset and returning halted = true
+// instead of copying any further once that many bytes have been copied.
+// Faults are checked only before each read, so when length is non-negative a
+// FailAt or StallAt at or beyond length has no effect.
+func faultyCopy(dst io.Writer, src io.Reader, length int64, faults faultParams, reset func()) (halted bool, written int64, err error) {
+	const step = 32 * 1024
+	stalled := false
+
+	for length < 0 || written < length {
+		n := int64(step)
+		if length >= 0 {
+			if remaining := length - written; remaining < n {
+				n = remaining
+			}
+		}
+
+		if faults.FailAt >= 0 {
+			if written >= faults.FailAt {
+				reset()
+				return true, written, nil
+			}
+			if d := faults.FailAt - written; d < n {
+				n = d
+			}
+		}
+		if faults.StallAt >= 0 && !stalled {
+			if written >= faults.StallAt {
+				time.Sleep(faults.StallFor)
+				stalled = true
+			} else if d := faults.StallAt - written; d < n {
+				n = d
+			}
+		}
+
+		copied, cerr := io.CopyN(dst, src, n)
+		written += copied
+		if cerr != nil {
+			if cerr == io.EOF && length < 0 {
+				return false, written, nil
+			}
+			return false, written, cerr
+		}
+	}
+
+	return false, written, nil
+}
+
+// resetConnection hijacks the connection underlying w and resets it via
+// resetAndClose. Used to simulate a client seeing a connection reset
+// partway through a request or response.
+func resetConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	resetAndClose(conn)
+}
+
+// resetAndClose closes conn after disabling the linger delay, if possible,
+// so the close sends a TCP RST rather than performing an orderly shutdown.
+func resetAndClose(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// writeSlowHeaders hijacks the connection underlying w and writes an
+// HTTP/1.1 status line and the headers already set on w for the given
+// status code, one byte at a time, spread evenly over duration. This
+// simulates a Slowloris-style server that is slow to finish sending
+// response headers. The caller is responsible for writing and closing the
+// returned connection.
+func writeSlowHeaders(w http.ResponseWriter, status int, duration time.Duration) (net.Conn, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("connection does not support hijacking")
+	}
+	conn, bufrw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	w.Header().Write(&head)
+	head.WriteString("\r\n")
+
+	data := head.Bytes()
+	delay := duration / time.Duration(len(data))
+	for _, b := range data {
+		if _, err := bufrw.Write([]byte{b}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := bufrw.Flush(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+	}
+
+	return conn, nil
 }
 
 func getLimit(req *http.Request) (rate.Limit, error) {
@@ -217,6 +888,27 @@ func getSize(req *http.Request) (int64, error) {
 	return DefaultDownloadSize, nil
 }
 
+// getMaxUploadSize returns the maximum allowed size for an upload body, in
+// bytes. A zero result means uploads are unbounded. The "maxSize" query
+// parameter can only tighten the server-wide -max-upload flag, never loosen
+// it, so a client cannot use it to defeat an operator-configured cap.
+func getMaxUploadSize(req *http.Request) (int64, error) {
+	maxSize := opts.MaxUpload
+
+	maxSizeParam := req.URL.Query().Get("maxSize")
+	if maxSizeParam != "" {
+		queryMaxSize, err := ParseSize(maxSizeParam)
+		if err != nil {
+			return 0, err
+		}
+		if maxSize <= 0 || (queryMaxSize > 0 && queryMaxSize < maxSize) {
+			maxSize = queryMaxSize
+		}
+	}
+
+	return maxSize, nil
+}
+
 func getDelays(req *http.Request) (pre time.Duration, res time.Duration, err error) {
 	parse := func(name string) (d time.Duration, err error) {
 		param := req.URL.Query().Get(name)
@@ -238,18 +930,179 @@ func getDelays(req *http.Request) (pre time.Duration, res time.Duration, err err
 	return
 }
 
+// RateLimitConfig configures the limits enforced by a RateLimiter.
+type RateLimitConfig struct {
+	// Rate is the maximum number of requests a single client may make within
+	// Window. Zero disables per-client rate limiting.
+	Rate int
+
+	// Window is the duration over which Rate applies.
+	Window time.Duration
+
+	// IPv6Mask is the number of leading bits of an IPv6 address used to
+	// identify a client, so that addresses in the same allocation share a
+	// limit. Defaults to 64 if zero.
+	IPv6Mask int
+
+	// MaxConcurrent is the maximum number of in-flight requests allowed
+	// across all clients at once. Zero disables the global limit.
+	MaxConcurrent int
+}
+
+// clientLimiter tracks the rate limiter for a single client and when it was
+// last used, so idle entries can be evicted from RateLimiter.clients.
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter wraps an http.Handler, enforcing a per-client-IP request rate
+// and a cap on the number of requests served concurrently across all
+// clients. It exists to let srcsnk be exposed to multiple untrusted clients
+// without one of them starving the others.
+type RateLimiter struct {
+	next   http.Handler
+	config RateLimitConfig
+
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
+
+	sem chan struct{} // nil if config.MaxConcurrent is 0
+}
+
+// NewRateLimiter creates a RateLimiter that forwards requests to next once
+// they pass the limits described by config.
+func NewRateLimiter(next http.Handler, config RateLimitConfig) *RateLimiter {
+	rl := &RateLimiter{
+		next:    next,
+		config:  config,
+		clients: make(map[string]*clientLimiter),
+	}
+	if config.MaxConcurrent > 0 {
+		rl.sem = make(chan struct{}, config.MaxConcurrent)
+	}
+	return rl
+}
+
+func (rl *RateLimiter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if rl.config.Rate > 0 {
+		key, err := clientKey(req, rl.config.IPv6Mask)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		limiter := rl.limiterFor(key, now)
+
+		res := limiter.ReserveN(now, 1)
+		if delay := res.DelayFrom(now); delay > 0 || !res.OK() {
+			res.CancelAt(now)
+			w.Header().Set("Retry-After", strconv.Itoa(int(delay.Round(time.Second)/time.Second)))
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(delay).Unix(), 10))
+			code := http.StatusTooManyRequests
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(limiter.TokensAt(now))))
+	}
+
+	if rl.sem != nil {
+		select {
+		case rl.sem <- struct{}{}:
+			defer func() { <-rl.sem }()
+		default:
+			code := http.StatusServiceUnavailable
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+	}
+
+	rl.next.ServeHTTP(w, req)
+}
+
+// limiterFor returns the rate.Limiter for the client identified by key,
+// creating one if necessary, and opportunistically evicts clients that have
+// been idle for more than ten limit windows.
+func (rl *RateLimiter) limiterFor(key string, now time.Time) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for k, c := range rl.clients {
+		if now.Sub(c.lastSeen) > 10*rl.config.Window {
+			delete(rl.clients, k)
+		}
+	}
+
+	c, ok := rl.clients[key]
+	if !ok {
+		limit := rate.Limit(float64(rl.config.Rate) / rl.config.Window.Seconds())
+		c = &clientLimiter{limiter: rate.NewLimiter(limit, rl.config.Rate)}
+		rl.clients[key] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+// clientKey identifies the client that sent req for the purposes of rate
+// limiting. IPv4 addresses are used as-is; IPv6 addresses are masked to
+// their leading ipv6Mask bits (or 64 if ipv6Mask is zero) so that a client
+// cannot evade the limit by cycling through addresses in its allocation.
+func clientKey(req *http.Request, ipv6Mask int) (string, error) {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", fmt.Errorf("could not parse client address: %s", req.RemoteAddr)
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String(), nil
+	}
+
+	if ipv6Mask <= 0 {
+		ipv6Mask = 64
+	}
+	return ip.Mask(net.CIDRMask(ipv6Mask, 128)).String(), nil
+}
+
 var opts struct {
-	Address string
+	Address       string
+	RateLimit     int
+	RateWindow    time.Duration
+	IPv6Mask      int
+	MaxConcurrent int
+	MaxUpload     int64
 }
 
 func defineAndParseFlags() {
 	flag.StringVar(&opts.Address, "address", "127.0.0.1:8000", "the address to listen on")
+	flag.IntVar(&opts.RateLimit, "rate-limit", 0, "maximum requests per client IP per -rate-window; 0 disables per-client rate limiting")
+	flag.DurationVar(&opts.RateWindow, "rate-window", time.Minute, "the window over which -rate-limit applies")
+	flag.IntVar(&opts.IPv6Mask, "ipv6-mask", 64, "number of bits used to identify an IPv6 client's allocation for rate limiting")
+	flag.IntVar(&opts.MaxConcurrent, "max-concurrent", 0, "maximum number of concurrent in-flight requests across all clients; 0 disables the limit")
+	flag.Func("max-upload", "maximum size, as accepted by ParseSize, of a PUT request body; 0 disables the limit", func(s string) (err error) {
+		opts.MaxUpload, err = ParseSize(s)
+		return err
+	})
 	flag.Parse()
 }
 
 func main() {
 	defineAndParseFlags()
 
+	var h http.Handler = &Handler{}
+	h = NewRateLimiter(h, RateLimitConfig{
+		Rate:          opts.RateLimit,
+		Window:        opts.RateWindow,
+		IPv6Mask:      opts.IPv6Mask,
+		MaxConcurrent: opts.MaxConcurrent,
+	})
+
 	log.Printf("Starting server on %s\n", opts.Address)
-	log.Fatal(http.ListenAndServe(opts.Address, &Handler{}))
+	log.Fatal(http.ListenAndServe(opts.Address, h))
 }